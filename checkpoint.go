@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// CheckpointEntry records how far a single container's scan has
+// progressed, so a later run with -resume can pick up where a prior
+// run left off instead of re-enumerating blobs it already counted.
+type CheckpointEntry struct {
+	Account           string        `json:"account"`
+	Container         string        `json:"container"`
+	ContinuationToken string        `json:"continuationToken,omitempty"`
+	Size              ContainerSize `json:"size"`
+	Done              bool          `json:"done"`
+}
+
+// Checkpoint is the on-disk state written to the -resume file. It is
+// safe for concurrent use since containers are checkpointed from
+// multiple worker goroutines.
+type Checkpoint struct {
+	mu      sync.Mutex
+	path    string
+	Entries map[string]CheckpointEntry `json:"entries"`
+}
+
+func checkpointKey(account, container string) string {
+	return account + "/" + container
+}
+
+// loadCheckpoint reads an existing checkpoint file, or returns an empty
+// one if the path doesn't exist yet (the common case for a first run).
+func loadCheckpoint(path string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{path: path, Entries: make(map[string]CheckpointEntry)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, err
+	}
+	if checkpoint.Entries == nil {
+		checkpoint.Entries = make(map[string]CheckpointEntry)
+	}
+	return checkpoint, nil
+}
+
+func (c *Checkpoint) get(account, container string) (CheckpointEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.Entries[checkpointKey(account, container)]
+	return entry, ok
+}
+
+func (c *Checkpoint) save(entry CheckpointEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Entries[checkpointKey(entry.Account, entry.Container)] = entry
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0o644)
+}
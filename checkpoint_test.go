@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestCheckpointKey(t *testing.T) {
+	if got, want := checkpointKey("acct", "container"), "acct/container"; got != want {
+		t.Errorf("checkpointKey = %q, want %q", got, want)
+	}
+}
+
+func TestLoadCheckpointMissingFile(t *testing.T) {
+	checkpoint, err := loadCheckpoint(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("loadCheckpoint returned error: %v", err)
+	}
+	if len(checkpoint.Entries) != 0 {
+		t.Errorf("expected an empty checkpoint, got %d entries", len(checkpoint.Entries))
+	}
+}
+
+func TestCheckpointSaveAndGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("loadCheckpoint returned error: %v", err)
+	}
+
+	entry := CheckpointEntry{Account: "acct", Container: "container", ContinuationToken: "token", Done: false}
+	if err := checkpoint.save(entry); err != nil {
+		t.Fatalf("save returned error: %v", err)
+	}
+
+	got, ok := checkpoint.get("acct", "container")
+	if !ok {
+		t.Fatal("expected entry to be found after save")
+	}
+	if got.Account != entry.Account || got.Container != entry.Container || got.ContinuationToken != entry.ContinuationToken || got.Done != entry.Done {
+		t.Errorf("get = %+v, want %+v", got, entry)
+	}
+
+	reloaded, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("failed to reload checkpoint from disk: %v", err)
+	}
+	if got, ok := reloaded.get("acct", "container"); !ok || got.ContinuationToken != "token" {
+		t.Errorf("reloaded checkpoint missing saved entry: %+v, ok=%v", got, ok)
+	}
+}
+
+func TestCheckpointGetMissing(t *testing.T) {
+	checkpoint, err := loadCheckpoint(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("loadCheckpoint returned error: %v", err)
+	}
+	if _, ok := checkpoint.get("acct", "container"); ok {
+		t.Error("expected get on an empty checkpoint to report not found")
+	}
+}
+
+func TestCheckpointSaveConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("loadCheckpoint returned error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			checkpoint.save(CheckpointEntry{Account: "acct", Container: string(rune('a' + i)), Done: true})
+		}(i)
+	}
+	wg.Wait()
+
+	if len(checkpoint.Entries) != 20 {
+		t.Errorf("expected 20 entries after concurrent saves, got %d", len(checkpoint.Entries))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read checkpoint file: %v", err)
+	}
+	var onDisk Checkpoint
+	if err := json.Unmarshal(data, &onDisk); err != nil {
+		t.Fatalf("checkpoint file is not valid JSON: %v", err)
+	}
+	if len(onDisk.Entries) != 20 {
+		t.Errorf("expected 20 entries persisted on disk, got %d", len(onDisk.Entries))
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// CredentialProvider builds the blob service client for a storage
+// account, hiding which auth mechanism (AAD credential, SAS token, or
+// connection string) is behind it.
+type CredentialProvider interface {
+	BlobServiceClient(accountName string) (*azblob.Client, error)
+}
+
+// tokenCredentialProvider builds clients backed by an azcore.TokenCredential,
+// e.g. DefaultAzureCredential, ClientSecretCredential, or WorkloadIdentityCredential.
+type tokenCredentialProvider struct {
+	credential azcore.TokenCredential
+}
+
+func (p tokenCredentialProvider) BlobServiceClient(accountName string) (*azblob.Client, error) {
+	serviceURL := fmt.Sprintf("https://%s.blob.core.windows.net/", accountName)
+	return azblob.NewClient(serviceURL, p.credential, nil)
+}
+
+// sasCredentialProvider builds clients authenticated with an
+// account-level SAS token, bypassing AAD entirely.
+type sasCredentialProvider struct {
+	sasToken string
+}
+
+func (p sasCredentialProvider) BlobServiceClient(accountName string) (*azblob.Client, error) {
+	serviceURL := fmt.Sprintf("https://%s.blob.core.windows.net/?%s", accountName, p.sasToken)
+	return azblob.NewClientWithNoCredential(serviceURL, nil)
+}
+
+// connectionStringCredentialProvider builds clients from a storage
+// account connection string, which already embeds the account name.
+type connectionStringCredentialProvider struct {
+	connectionString string
+}
+
+func (p connectionStringCredentialProvider) BlobServiceClient(accountName string) (*azblob.Client, error) {
+	return azblob.NewClientFromConnectionString(p.connectionString, nil)
+}
+
+// AccountCredentialConfig overrides how a single storage account is
+// authenticated, as loaded from a -credentials-config file. Type selects
+// which of the other fields apply: "default", "sas", or "connection-string".
+type AccountCredentialConfig struct {
+	Account          string `json:"account"`
+	Type             string `json:"type"`
+	SAS              string `json:"sas,omitempty"`
+	ConnectionString string `json:"connectionString,omitempty"`
+}
+
+func loadCredentialConfig(path string) (map[string]AccountCredentialConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []AccountCredentialConfig
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]AccountCredentialConfig, len(entries))
+	for _, entry := range entries {
+		config[entry.Account] = entry
+	}
+	return config, nil
+}
+
+// credentialResolver picks the CredentialProvider for an account: a
+// per-account override from -credentials-config wins, otherwise it
+// falls back to whichever global auth flag was supplied, and finally to
+// the default token credential chain.
+type credentialResolver struct {
+	defaultProvider CredentialProvider
+	perAccount      map[string]AccountCredentialConfig
+}
+
+func (r *credentialResolver) resolve(accountName string) (CredentialProvider, error) {
+	override, ok := r.perAccount[accountName]
+	if !ok {
+		return r.defaultProvider, nil
+	}
+
+	switch override.Type {
+	case "", "default":
+		return r.defaultProvider, nil
+	case "sas":
+		return sasCredentialProvider{sasToken: override.SAS}, nil
+	case "connection-string":
+		return connectionStringCredentialProvider{connectionString: override.ConnectionString}, nil
+	default:
+		return nil, fmt.Errorf("unknown credential type %q for account %s", override.Type, accountName)
+	}
+}
+
+func (r *credentialResolver) BlobServiceClient(accountName string) (*azblob.Client, error) {
+	provider, err := r.resolve(accountName)
+	if err != nil {
+		return nil, err
+	}
+	return provider.BlobServiceClient(accountName)
+}
+
+// newARMCredential builds the azcore.TokenCredential used for ARM calls
+// (subscription listing, storage account discovery, Azure Monitor
+// metrics), selecting ClientSecretCredential or WorkloadIdentityCredential
+// when the caller opted in, and DefaultAzureCredential otherwise.
+func newARMCredential(tenantID, clientID, clientSecret string, workloadIdentity bool) (azcore.TokenCredential, error) {
+	switch {
+	case workloadIdentity:
+		return azidentity.NewWorkloadIdentityCredential(nil)
+	case tenantID != "" || clientID != "" || clientSecret != "":
+		if tenantID == "" || clientID == "" || clientSecret == "" {
+			return nil, fmt.Errorf("-tenant, -client-id, and -client-secret must all be set together")
+		}
+		return azidentity.NewClientSecretCredential(tenantID, clientID, clientSecret, nil)
+	default:
+		return azidentity.NewDefaultAzureCredential(nil)
+	}
+}
+
+// newDefaultBlobProvider picks the global (non-per-account) blob
+// credential provider based on the -sas / -connection-string / AAD flags.
+// explicitAccounts and discoverAccounts describe how many accounts this
+// provider will end up serving, since a SAS token or connection string is
+// scoped to a single storage account and can't safely be the default for
+// a multi-account scan.
+func newDefaultBlobProvider(armCredential azcore.TokenCredential, sas, connectionString string, explicitAccounts []string, discoverAccounts bool) (CredentialProvider, error) {
+	switch {
+	case sas != "" && connectionString != "":
+		return nil, fmt.Errorf("-sas and -connection-string are mutually exclusive")
+	case sas != "":
+		if discoverAccounts || len(explicitAccounts) > 1 {
+			return nil, fmt.Errorf("-sas is signed for a single storage account and can't be used as the default credential for more than one account; use -credentials-config to set it per-account instead")
+		}
+		return sasCredentialProvider{sasToken: sas}, nil
+	case connectionString != "":
+		if discoverAccounts || len(explicitAccounts) > 1 {
+			return nil, fmt.Errorf("-connection-string names a single storage account and can't be used as the default credential for more than one account; use -credentials-config to set it per-account instead")
+		}
+		return connectionStringCredentialProvider{connectionString: connectionString}, nil
+	default:
+		return tokenCredentialProvider{credential: armCredential}, nil
+	}
+}
@@ -5,54 +5,185 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 )
 
 func main() {
 	var accounts string
+	var output string
+	var mode string
+	var listenAddr string
+	var refreshInterval time.Duration
+	var includeSnapshots bool
+	var includeVersions bool
+	var includeDeleted bool
+	var priceSheetPath string
+	var maxConcurrency int
+	var resumePath string
+	var subscriptionFlag string
+	var allSubscriptions bool
+	var discoverAccounts bool
+	var tenantID string
+	var clientID string
+	var clientSecret string
+	var workloadIdentity bool
+	var sas string
+	var connectionString string
+	var credentialsConfigPath string
 	flag.StringVar(&accounts, "accounts", "", "Comma-separated list of storage account names")
+	flag.StringVar(&output, "output", "text", "Output format: text|json|csv|prometheus")
+	flag.StringVar(&mode, "mode", "enumerate", "Size collection mode: enumerate|metrics")
+	flag.StringVar(&listenAddr, "listen-addr", ":9100", "Address to serve Prometheus metrics on (prometheus output only)")
+	flag.DurationVar(&refreshInterval, "refresh-interval", 5*time.Minute, "How often to rescan accounts in prometheus output mode")
+	flag.BoolVar(&includeSnapshots, "include-snapshots", false, "Include blob snapshots in size totals, broken out separately")
+	flag.BoolVar(&includeVersions, "include-versions", false, "Include previous blob versions in size totals, broken out separately")
+	flag.BoolVar(&includeDeleted, "include-deleted", false, "Include soft-deleted blobs in size totals, broken out separately")
+	flag.StringVar(&priceSheetPath, "price-sheet", "", "Path to a JSON file mapping access tier to USD price per GB-month, for cost estimation")
+	flag.IntVar(&maxConcurrency, "max-concurrency", 10, "Maximum number of containers to scan concurrently per account")
+	flag.StringVar(&resumePath, "resume", "", "Path to a checkpoint file to resume an interrupted scan from, and to keep updated as this run progresses")
+	flag.StringVar(&subscriptionFlag, "subscription", "", "Subscription ID to use, skipping the interactive prompt")
+	flag.BoolVar(&allSubscriptions, "all-subscriptions", false, "Scan every subscription the credential can see, instead of just one")
+	flag.BoolVar(&discoverAccounts, "discover-accounts", false, "Discover storage accounts in each subscription instead of requiring -accounts")
+	flag.StringVar(&tenantID, "tenant", "", "Azure AD tenant ID, for client-secret auth (use with -client-id and -client-secret)")
+	flag.StringVar(&clientID, "client-id", "", "Azure AD client ID, for client-secret auth")
+	flag.StringVar(&clientSecret, "client-secret", "", "Azure AD client secret, for client-secret auth")
+	flag.BoolVar(&workloadIdentity, "workload-identity", false, "Authenticate with WorkloadIdentityCredential (for AKS pods) instead of DefaultAzureCredential")
+	flag.StringVar(&sas, "sas", "", "Account-level SAS token to use for blob access instead of an AAD credential")
+	flag.StringVar(&connectionString, "connection-string", "", "Storage account connection string to use for blob access instead of an AAD credential")
+	flag.StringVar(&credentialsConfigPath, "credentials-config", "", "Path to a JSON file of per-account credential overrides")
 	flag.Parse()
 
-	if accounts == "" {
-		log.Fatal("Please provide a list of accounts using the -accounts flag")
+	if maxConcurrency < 1 {
+		log.Fatalf("Invalid -max-concurrency %d: must be at least 1", maxConcurrency)
 	}
 
-	storageAccounts := strings.Split(accounts, ",")
+	var checkpoint *Checkpoint
+	if resumePath != "" {
+		loaded, err := loadCheckpoint(resumePath)
+		if err != nil {
+			log.Fatalf("Error loading checkpoint: %v", err)
+		}
+		checkpoint = loaded
+	}
+
+	includeOpts := IncludeOptions{
+		Snapshots: includeSnapshots,
+		Versions:  includeVersions,
+		Deleted:   includeDeleted,
+	}
+
+	var priceSheet PriceSheet
+	if priceSheetPath != "" {
+		sheet, err := loadPriceSheet(priceSheetPath)
+		if err != nil {
+			log.Fatalf("Error loading price sheet: %v", err)
+		}
+		priceSheet = sheet
+	}
+
+	if mode != "enumerate" && mode != "metrics" {
+		log.Fatalf("Invalid -mode %q: must be enumerate or metrics", mode)
+	}
+
+	if accounts == "" && !discoverAccounts {
+		log.Fatal("Please provide a list of accounts using the -accounts flag, or pass -discover-accounts")
+	}
+	if allSubscriptions && accounts != "" && !discoverAccounts {
+		log.Fatal("-all-subscriptions with an explicit -accounts list would scan each account once per subscription; pass -discover-accounts instead, or drop -all-subscriptions and use -subscription")
+	}
+
+	var explicitAccounts []string
+	if accounts != "" {
+		explicitAccounts = strings.Split(accounts, ",")
+	}
 
 	// Obtener credenciales de Azure
-	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	credential, err := newARMCredential(tenantID, clientID, clientSecret, workloadIdentity)
 	if err != nil {
 		log.Fatalf("Error obtaining credentials: %v", err)
 	}
 
-	// Seleccionar suscripción
-	subscriptionID, err := selectSubscription(credential)
+	defaultBlobProvider, err := newDefaultBlobProvider(credential, sas, connectionString, explicitAccounts, discoverAccounts)
 	if err != nil {
-		log.Fatalf("Error selecting subscription: %v", err)
+		log.Fatalf("Error configuring blob credentials: %v", err)
 	}
 
-	fmt.Printf("Using subscription: %s\n\n", subscriptionID)
+	var perAccountCredentials map[string]AccountCredentialConfig
+	if credentialsConfigPath != "" {
+		perAccountCredentials, err = loadCredentialConfig(credentialsConfigPath)
+		if err != nil {
+			log.Fatalf("Error loading credentials config: %v", err)
+		}
+	}
+
+	resolver := &credentialResolver{defaultProvider: defaultBlobProvider, perAccount: perAccountCredentials}
+
+	var subscriptionIDs []string
+	switch {
+	case allSubscriptions:
+		subscriptionIDs, err = listAllSubscriptionIDs(credential)
+		if err != nil {
+			log.Fatalf("Error listing subscriptions: %v", err)
+		}
+	case subscriptionFlag != "":
+		subscriptionIDs = []string{subscriptionFlag}
+	default:
+		selected, err := selectSubscription(credential)
+		if err != nil {
+			log.Fatalf("Error selecting subscription: %v", err)
+		}
+		subscriptionIDs = []string{selected}
+	}
+
+	collect := func() []AccountResult {
+		var results []AccountResult
+		for _, subID := range subscriptionIDs {
+			log.Printf("Using subscription: %s", subID)
+
+			storageAccounts := explicitAccounts
+			if discoverAccounts {
+				discovered, err := discoverStorageAccounts(context.Background(), credential, subID)
+				if err != nil {
+					log.Printf("Error discovering storage accounts in subscription %s: %v", subID, err)
+					continue
+				}
+				storageAccounts = discovered
+			}
 
-	for _, account := range storageAccounts {
-		fmt.Printf("Processing account: %s\n", account)
-		processAccount(account, credential, subscriptionID)
-		fmt.Println()
+			for _, account := range storageAccounts {
+				results = append(results, processAccount(account, credential, resolver, subID, mode, includeOpts, priceSheet, maxConcurrency, checkpoint))
+			}
+		}
+		return results
+	}
+
+	if output == "prometheus" {
+		if err := serveMetrics(listenAddr, refreshInterval, collect); err != nil {
+			log.Fatalf("Error serving metrics: %v", err)
+		}
+		return
+	}
+
+	if err := renderResults(os.Stdout, output, collect()); err != nil {
+		log.Fatalf("Error rendering results: %v", err)
 	}
 }
 
-func selectSubscription(credential *azidentity.DefaultAzureCredential) (string, error) {
+func selectSubscription(credential azcore.TokenCredential) (string, error) {
 	client, err := armsubscriptions.NewClient(credential, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create client: %v", err)
 	}
 
 	pager := client.NewListPager(nil)
-	subscriptions := []armsubscriptions.Subscription{}
+	subscriptions := []*armsubscriptions.Subscription{}
 
 	for pager.More() {
 		page, err := pager.NextPage(context.Background())
@@ -77,56 +208,280 @@ func selectSubscription(credential *azidentity.DefaultAzureCredential) (string,
 	return *subscriptions[choice-1].SubscriptionID, nil
 }
 
-func processAccount(accountName string, credential *azidentity.DefaultAzureCredential, subscriptionID string) {
-	serviceURL := fmt.Sprintf("https://%s.blob.core.windows.net/", accountName)
-	serviceClient, err := azblob.NewClient(serviceURL, credential, nil)
+func processAccount(accountName string, armCredential azcore.TokenCredential, blobProvider CredentialProvider, subscriptionID string, mode string, includeOpts IncludeOptions, priceSheet PriceSheet, maxConcurrency int, checkpoint *Checkpoint) AccountResult {
+	if mode == "metrics" {
+		if includeOpts.Snapshots || includeOpts.Versions || includeOpts.Deleted || len(priceSheet) > 0 {
+			log.Printf("Account %s: per-container breakdown (snapshots/versions/deleted/price-sheet) requested, falling back to enumeration since Azure Monitor only reports account-level totals", accountName)
+		} else {
+			metrics, err := getAccountSizeViaMetrics(context.Background(), armCredential, subscriptionID, accountName)
+			if err == nil {
+				return AccountResult{Account: accountName, TotalBytes: metrics.CapacityBytes}
+			}
+			log.Printf("Metrics unavailable for account %s, falling back to enumeration: %v", accountName, err)
+		}
+	}
+
+	serviceClient, err := blobProvider.BlobServiceClient(accountName)
 	if err != nil {
 		log.Printf("Error creating service client for account %s: %v", accountName, err)
-		return
+		return AccountResult{Account: accountName}
 	}
 
 	ctx := context.Background()
 	containerList, err := listContainers(ctx, serviceClient)
 	if err != nil {
 		log.Printf("Error listing containers for account %s: %v", accountName, err)
-		return
+		return AccountResult{Account: accountName}
 	}
 
 	var wg sync.WaitGroup
-	results := make(chan ContainerSize, len(containerList))
+	sizes := make(chan ContainerSize, len(containerList))
+	sem := make(chan struct{}, maxConcurrency)
 
 	for _, containerName := range containerList {
+		if checkpoint != nil {
+			if entry, ok := checkpoint.get(accountName, containerName); ok && entry.Done {
+				sizes <- entry.Size
+				continue
+			}
+		}
+
 		wg.Add(1)
+		sem <- struct{}{}
 		go func(containerName string) {
 			defer wg.Done()
-			size, err := getContainerSize(ctx, serviceClient, containerName)
+			defer func() { <-sem }()
+
+			size, err := scanContainer(ctx, serviceClient, accountName, containerName, includeOpts, priceSheet, maxConcurrency, checkpoint)
 			if err != nil {
 				log.Printf("Error processing container %s in account %s: %v", containerName, accountName, err)
 				return
 			}
-			results <- ContainerSize{Name: containerName, Size: size}
+			sizes <- size
 		}(containerName)
 	}
 
 	go func() {
 		wg.Wait()
-		close(results)
+		close(sizes)
 	}()
 
+	result := AccountResult{Account: accountName}
 	var totalSize int64
-	for result := range results {
-		sizeGB := bytesToGB(result.Size)
-		fmt.Printf("Container: %s, Size: %.2f GB\n", result.Name, sizeGB)
-		totalSize += result.Size
+	var totalCost float64
+	for size := range sizes {
+		result.Containers = append(result.Containers, size)
+		totalSize += size.Size
+		totalCost += size.EstimatedCost
 	}
+	result.TotalBytes = totalSize
+	result.EstimatedCost = totalCost
 
-	totalSizeGB := bytesToGB(totalSize)
-	fmt.Printf("Total size for account %s: %.2f GB\n", accountName, totalSizeGB)
+	return result
 }
 
+// ContainerSize breaks a container's total size down by blob category so
+// callers can tell active capacity apart from snapshots, older versions,
+// and soft-deleted blobs that Azure still bills for.
 type ContainerSize struct {
-	Name string
-	Size int64
+	Name          string           `json:"name"`
+	Size          int64            `json:"sizeBytes"`
+	ActiveBytes   int64            `json:"activeBytes"`
+	SnapshotBytes int64            `json:"snapshotBytes,omitempty"`
+	VersionBytes  int64            `json:"versionBytes,omitempty"`
+	DeletedBytes  int64            `json:"deletedBytes,omitempty"`
+	TierBytes     map[string]int64 `json:"tierBytes,omitempty"`
+	TypeBytes     map[string]int64 `json:"typeBytes,omitempty"`
+	EstimatedCost float64          `json:"estimatedMonthlyCost,omitempty"`
+}
+
+// cloneContainerSize returns a copy of size whose TierBytes/TypeBytes maps
+// are independent of the original's. A plain struct assignment would leave
+// both copies pointing at the same underlying maps, which is unsafe once
+// one of them (e.g. a checkpoint entry still read by Checkpoint.save) is
+// accessed concurrently with the other being mutated by a resumed scan.
+func cloneContainerSize(size ContainerSize) ContainerSize {
+	clone := size
+	clone.TierBytes = make(map[string]int64, len(size.TierBytes))
+	for tier, bytes := range size.TierBytes {
+		clone.TierBytes[tier] = bytes
+	}
+	clone.TypeBytes = make(map[string]int64, len(size.TypeBytes))
+	for blobType, bytes := range size.TypeBytes {
+		clone.TypeBytes[blobType] = bytes
+	}
+	return clone
+}
+
+// mergeContainerSize folds part's counters and maps into into, so several
+// prefix shards of the same container can be combined into one result.
+func mergeContainerSize(into *ContainerSize, part ContainerSize) {
+	into.Size += part.Size
+	into.ActiveBytes += part.ActiveBytes
+	into.SnapshotBytes += part.SnapshotBytes
+	into.VersionBytes += part.VersionBytes
+	into.DeletedBytes += part.DeletedBytes
+	into.EstimatedCost += part.EstimatedCost
+	for tier, bytes := range part.TierBytes {
+		into.TierBytes[tier] += bytes
+	}
+	for blobType, bytes := range part.TypeBytes {
+		into.TypeBytes[blobType] += bytes
+	}
+}
+
+// shardCheckpointKey names the checkpoint entry for one prefix shard of a
+// container, distinct from the entry for the container as a whole so a
+// sharded scan and a flat scan of the same container never collide.
+func shardCheckpointKey(containerName, prefix string) string {
+	return containerName + "#" + prefix
+}
+
+// listBlobPrefixes returns a container's top-level "/"-delimited blob name
+// prefixes (its first-level virtual directories), so a large container can
+// be split into independent listings instead of paged through as one.
+// It returns no prefixes when any blob sits directly at the container root,
+// since such a blob falls under none of the prefixes.
+func listBlobPrefixes(ctx context.Context, client *azblob.Client, containerName string) ([]string, error) {
+	containerClient := client.ServiceClient().NewContainerClient(containerName)
+	pager := containerClient.NewListBlobsHierarchyPager("/", nil)
+
+	var prefixes []string
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Segment.BlobItems) > 0 {
+			return nil, nil
+		}
+		for _, blobPrefix := range resp.Segment.BlobPrefixes {
+			prefixes = append(prefixes, *blobPrefix.Name)
+		}
+	}
+	return prefixes, nil
+}
+
+// scanContainer sizes a single container, resuming from checkpoint state
+// when available. When the container has more than one top-level prefix,
+// it fans out a bounded pool of goroutines across those prefixes so a
+// container with millions of blobs isn't paid for with one long sequential
+// listing; containers with zero or one prefix, or with blobs at the root,
+// fall back to a single listing.
+func scanContainer(ctx context.Context, client *azblob.Client, accountName, containerName string, includeOpts IncludeOptions, priceSheet PriceSheet, maxConcurrency int, checkpoint *Checkpoint) (ContainerSize, error) {
+	if checkpoint != nil {
+		if entry, ok := checkpoint.get(accountName, containerName); ok && entry.ContinuationToken != "" && !entry.Done {
+			return scanContainerFlat(ctx, client, accountName, containerName, "", includeOpts, priceSheet, checkpoint)
+		}
+	}
+
+	prefixes, err := listBlobPrefixes(ctx, client, containerName)
+	if err != nil {
+		return ContainerSize{}, err
+	}
+	if len(prefixes) < 2 {
+		return scanContainerFlat(ctx, client, accountName, containerName, "", includeOpts, priceSheet, checkpoint)
+	}
+
+	result := ContainerSize{
+		Name:      containerName,
+		TierBytes: make(map[string]int64),
+		TypeBytes: make(map[string]int64),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrency)
+	errs := make(chan error, len(prefixes))
+
+	for _, prefix := range prefixes {
+		if checkpoint != nil {
+			if entry, ok := checkpoint.get(accountName, shardCheckpointKey(containerName, prefix)); ok && entry.Done {
+				mu.Lock()
+				mergeContainerSize(&result, entry.Size)
+				mu.Unlock()
+				continue
+			}
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(prefix string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			shard, err := scanContainerFlat(ctx, client, accountName, containerName, prefix, includeOpts, priceSheet, checkpoint)
+			if err != nil {
+				errs <- fmt.Errorf("prefix %q: %w", prefix, err)
+				return
+			}
+			mu.Lock()
+			mergeContainerSize(&result, shard)
+			mu.Unlock()
+		}(prefix)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		return ContainerSize{}, err
+	}
+
+	if checkpoint != nil {
+		if err := checkpoint.save(CheckpointEntry{Account: accountName, Container: containerName, Size: result, Done: true}); err != nil {
+			log.Printf("Error saving checkpoint for %s/%s: %v", accountName, containerName, err)
+		}
+	}
+	return result, nil
+}
+
+// scanContainerFlat scans a container (or, with prefix set, one of its
+// shards) with a single sequential listing, checkpointing progress under
+// containerName or its shard key as pages come back.
+func scanContainerFlat(ctx context.Context, client *azblob.Client, accountName, containerName, prefix string, includeOpts IncludeOptions, priceSheet PriceSheet, checkpoint *Checkpoint) (ContainerSize, error) {
+	checkpointName := containerName
+	if prefix != "" {
+		checkpointName = shardCheckpointKey(containerName, prefix)
+	}
+
+	var resumeFrom *CheckpointEntry
+	if checkpoint != nil {
+		if entry, ok := checkpoint.get(accountName, checkpointName); ok {
+			resumeFrom = &entry
+		}
+	}
+
+	var onPage func(marker *string, partial ContainerSize)
+	if checkpoint != nil {
+		onPage = func(marker *string, partial ContainerSize) {
+			token := ""
+			if marker != nil {
+				token = *marker
+			}
+			if err := checkpoint.save(CheckpointEntry{Account: accountName, Container: checkpointName, ContinuationToken: token, Size: cloneContainerSize(partial)}); err != nil {
+				log.Printf("Error saving checkpoint for %s/%s: %v", accountName, checkpointName, err)
+			}
+		}
+	}
+
+	size, err := getContainerSizeWithPrefix(ctx, client, containerName, prefix, includeOpts, priceSheet, resumeFrom, onPage)
+	if err != nil {
+		return size, err
+	}
+	if checkpoint != nil {
+		if err := checkpoint.save(CheckpointEntry{Account: accountName, Container: checkpointName, Size: size, Done: true}); err != nil {
+			log.Printf("Error saving checkpoint for %s/%s: %v", accountName, checkpointName, err)
+		}
+	}
+	return size, nil
+}
+
+// IncludeOptions controls which non-current blob categories are fetched
+// and aggregated alongside the active size of a container.
+type IncludeOptions struct {
+	Snapshots bool
+	Versions  bool
+	Deleted   bool
 }
 
 func listContainers(ctx context.Context, client *azblob.Client) ([]string, error) {
@@ -145,22 +500,74 @@ func listContainers(ctx context.Context, client *azblob.Client) ([]string, error
 	return containers, nil
 }
 
-func getContainerSize(ctx context.Context, client *azblob.Client, containerName string) (int64, error) {
-	var totalSize int64
+// getContainerSize pages through an entire container with a single
+// sequential listing. Use getContainerSizeWithPrefix instead to scope the
+// listing to one of the container's top-level prefixes.
+func getContainerSize(ctx context.Context, client *azblob.Client, containerName string, includeOpts IncludeOptions, priceSheet PriceSheet, resumeFrom *CheckpointEntry, onPage func(marker *string, partial ContainerSize)) (ContainerSize, error) {
+	return getContainerSizeWithPrefix(ctx, client, containerName, "", includeOpts, priceSheet, resumeFrom, onPage)
+}
+
+func getContainerSizeWithPrefix(ctx context.Context, client *azblob.Client, containerName, prefix string, includeOpts IncludeOptions, priceSheet PriceSheet, resumeFrom *CheckpointEntry, onPage func(marker *string, partial ContainerSize)) (ContainerSize, error) {
+	result := ContainerSize{
+		Name:      containerName,
+		TierBytes: make(map[string]int64),
+		TypeBytes: make(map[string]int64),
+	}
+
+	options := &azblob.ListBlobsFlatOptions{
+		Include: azblob.ListBlobsInclude{
+			Snapshots: includeOpts.Snapshots,
+			Versions:  includeOpts.Versions,
+			Deleted:   includeOpts.Deleted,
+		},
+	}
+	if prefix != "" {
+		options.Prefix = &prefix
+	}
+	if resumeFrom != nil && resumeFrom.ContinuationToken != "" {
+		result = cloneContainerSize(resumeFrom.Size)
+		options.Marker = &resumeFrom.ContinuationToken
+	}
 
-	pager := client.NewListBlobsFlatPager(containerName, &azblob.ListBlobsFlatOptions{})
+	pager := client.NewListBlobsFlatPager(containerName, options)
 
 	for pager.More() {
 		resp, err := pager.NextPage(ctx)
 		if err != nil {
-			return 0, err
+			return result, err
 		}
 		for _, blob := range resp.Segment.BlobItems {
-			totalSize += *blob.Properties.ContentLength
+			length := *blob.Properties.ContentLength
+			switch {
+			case blob.Deleted != nil && *blob.Deleted:
+				result.DeletedBytes += length
+			case blob.Snapshot != nil && *blob.Snapshot != "":
+				result.SnapshotBytes += length
+			case blob.VersionID != nil && blob.IsCurrentVersion != nil && !*blob.IsCurrentVersion:
+				result.VersionBytes += length
+			default:
+				result.ActiveBytes += length
+			}
+			result.Size += length
+
+			if blob.Properties.AccessTier != nil {
+				result.TierBytes[string(*blob.Properties.AccessTier)] += length
+			}
+			if blob.Properties.BlobType != nil {
+				result.TypeBytes[string(*blob.Properties.BlobType)] += length
+			}
 		}
+
+		if onPage != nil {
+			onPage(resp.NextMarker, result)
+		}
+	}
+
+	if priceSheet != nil {
+		result.EstimatedCost = estimateMonthlyCost(result.TierBytes, priceSheet)
 	}
 
-	return totalSize, nil
+	return result, nil
 }
 
 func bytesToGB(bytes int64) float64 {
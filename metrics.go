@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+)
+
+// accountMetrics is the account-level size summary reported by Azure
+// Monitor, as an alternative to enumerating every blob.
+type accountMetrics struct {
+	CapacityBytes  int64
+	ContainerCount int64
+	BlobCount      int64
+}
+
+// findStorageAccountResourceID looks up the full ARM resource ID for a
+// storage account name by listing every account in the subscription,
+// since the metrics API is addressed by resource ID rather than name.
+func findStorageAccountResourceID(ctx context.Context, credential azcore.TokenCredential, subscriptionID, accountName string) (string, error) {
+	client, err := armstorage.NewAccountsClient(subscriptionID, credential, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create storage accounts client: %v", err)
+	}
+
+	pager := client.NewListPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to list storage accounts: %v", err)
+		}
+		for _, account := range page.Value {
+			if account.Name != nil && *account.Name == accountName {
+				return *account.ID, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("storage account %q not found in subscription %s", accountName, subscriptionID)
+}
+
+// getAccountSizeViaMetrics fetches BlobCapacity, ContainerCount, and
+// BlobCount from Azure Monitor for the account's blob service, avoiding
+// a full blob enumeration. It returns an error if any metric is missing,
+// so callers can fall back to enumeration.
+func getAccountSizeViaMetrics(ctx context.Context, credential azcore.TokenCredential, subscriptionID, accountName string) (accountMetrics, error) {
+	resourceID, err := findStorageAccountResourceID(ctx, credential, subscriptionID, accountName)
+	if err != nil {
+		return accountMetrics{}, err
+	}
+
+	client, err := armmonitor.NewMetricsClient(subscriptionID, credential, nil)
+	if err != nil {
+		return accountMetrics{}, fmt.Errorf("failed to create monitor client: %v", err)
+	}
+
+	blobServiceID := resourceID + "/blobServices/default"
+	metricNames := "BlobCapacity,ContainerCount,BlobCount"
+	aggregation := "Average"
+	resp, err := client.List(ctx, blobServiceID, &armmonitor.MetricsClientListOptions{
+		Metricnames: &metricNames,
+		Aggregation: &aggregation,
+	})
+	if err != nil {
+		return accountMetrics{}, fmt.Errorf("failed to list metrics for %s: %v", accountName, err)
+	}
+
+	result := accountMetrics{}
+	seen := make(map[string]bool)
+	for _, metric := range resp.Value {
+		if metric.Name == nil || metric.Name.Value == nil {
+			continue
+		}
+		value, ok := latestMetricValue(metric)
+		if !ok {
+			return accountMetrics{}, fmt.Errorf("metric %s has no data points for %s", *metric.Name.Value, accountName)
+		}
+		seen[*metric.Name.Value] = true
+		switch *metric.Name.Value {
+		case "BlobCapacity":
+			result.CapacityBytes = int64(value)
+		case "ContainerCount":
+			result.ContainerCount = int64(value)
+		case "BlobCount":
+			result.BlobCount = int64(value)
+		}
+	}
+	for _, name := range []string{"BlobCapacity", "ContainerCount", "BlobCount"} {
+		if !seen[name] {
+			return accountMetrics{}, fmt.Errorf("metric %s missing from response for %s", name, accountName)
+		}
+	}
+
+	return result, nil
+}
+
+// latestMetricValue returns the most recent Average data point across
+// all timeseries for a metric.
+func latestMetricValue(metric *armmonitor.Metric) (float64, bool) {
+	var latest *armmonitor.MetricValue
+	for _, series := range metric.Timeseries {
+		for _, point := range series.Data {
+			if point.Average == nil {
+				continue
+			}
+			if latest == nil || point.TimeStamp.After(*latest.TimeStamp) {
+				latest = point
+			}
+		}
+	}
+	if latest == nil {
+		return 0, false
+	}
+	return *latest.Average, true
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// AccountResult holds the size of every container scanned in a single
+// storage account, plus the account total, so results can be rendered
+// in whichever output format the caller asked for.
+type AccountResult struct {
+	Account       string          `json:"account"`
+	Containers    []ContainerSize `json:"containers"`
+	TotalBytes    int64           `json:"totalBytes"`
+	EstimatedCost float64         `json:"estimatedMonthlyCost,omitempty"`
+}
+
+func renderResults(w io.Writer, format string, results []AccountResult) error {
+	switch format {
+	case "", "text":
+		renderText(w, results)
+		return nil
+	case "json":
+		return renderJSON(w, results)
+	case "csv":
+		return renderCSV(w, results)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+func renderText(w io.Writer, results []AccountResult) {
+	for _, result := range results {
+		fmt.Fprintf(w, "Processing account: %s\n", result.Account)
+		for _, container := range result.Containers {
+			fmt.Fprintf(w, "Container: %s, Size: %.2f GB\n", container.Name, bytesToGB(container.Size))
+			if container.SnapshotBytes > 0 || container.VersionBytes > 0 || container.DeletedBytes > 0 {
+				fmt.Fprintf(w, "  active: %.2f GB, snapshots: %.2f GB, versions: %.2f GB, deleted: %.2f GB\n",
+					bytesToGB(container.ActiveBytes), bytesToGB(container.SnapshotBytes), bytesToGB(container.VersionBytes), bytesToGB(container.DeletedBytes))
+			}
+		}
+		fmt.Fprintf(w, "Total size for account %s: %.2f GB\n", result.Account, bytesToGB(result.TotalBytes))
+		if result.EstimatedCost > 0 {
+			fmt.Fprintf(w, "Estimated monthly cost for account %s: $%.2f\n", result.Account, result.EstimatedCost)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func renderJSON(w io.Writer, results []AccountResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+func renderCSV(w io.Writer, results []AccountResult) error {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	header := []string{"account", "container", "size_bytes", "active_bytes", "snapshot_bytes", "version_bytes", "deleted_bytes", "estimated_monthly_cost"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, result := range results {
+		for _, container := range result.Containers {
+			row := []string{
+				result.Account,
+				container.Name,
+				strconv.FormatInt(container.Size, 10),
+				strconv.FormatInt(container.ActiveBytes, 10),
+				strconv.FormatInt(container.SnapshotBytes, 10),
+				strconv.FormatInt(container.VersionBytes, 10),
+				strconv.FormatInt(container.DeletedBytes, 10),
+				strconv.FormatFloat(container.EstimatedCost, 'f', 2, 64),
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		totalRow := []string{result.Account, "TOTAL", strconv.FormatInt(result.TotalBytes, 10), "", "", "", "", strconv.FormatFloat(result.EstimatedCost, 'f', 2, 64)}
+		if err := writer.Write(totalRow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prometheusExporter keeps the most recently collected results available
+// for scraping at /metrics, re-populating the gauges on every collect call.
+type prometheusExporter struct {
+	containerSize *prometheus.GaugeVec
+	accountSize   *prometheus.GaugeVec
+}
+
+func newPrometheusExporter() *prometheusExporter {
+	exporter := &prometheusExporter{
+		containerSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "azure_blob_container_size_bytes",
+			Help: "Total size in bytes of a blob container.",
+		}, []string{"account", "container"}),
+		accountSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "azure_blob_account_size_bytes",
+			Help: "Total size in bytes of all containers in a storage account.",
+		}, []string{"account"}),
+	}
+	prometheus.MustRegister(exporter.containerSize, exporter.accountSize)
+	return exporter
+}
+
+func (e *prometheusExporter) update(results []AccountResult) {
+	e.accountSize.Reset()
+	e.containerSize.Reset()
+	for _, result := range results {
+		e.accountSize.WithLabelValues(result.Account).Set(float64(result.TotalBytes))
+		for _, container := range result.Containers {
+			e.containerSize.WithLabelValues(result.Account, container.Name).Set(float64(container.Size))
+		}
+	}
+}
+
+// serveMetrics starts the Prometheus HTTP endpoint and blocks forever,
+// refreshing the gauges by calling collect on every tick.
+func serveMetrics(listenAddr string, refreshInterval time.Duration, collect func() []AccountResult) error {
+	exporter := newPrometheusExporter()
+	exporter.update(collect())
+
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			exporter.update(collect())
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	log.Printf("Serving Prometheus metrics on %s/metrics (refresh every %s)", listenAddr, refreshInterval)
+	return http.ListenAndServe(listenAddr, mux)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// PriceSheet maps an access tier name (Hot, Cool, Cold, Archive) to its
+// price in USD per GB per month, as loaded from a -price-sheet file.
+type PriceSheet map[string]float64
+
+func loadPriceSheet(path string) (PriceSheet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sheet PriceSheet
+	if err := json.Unmarshal(data, &sheet); err != nil {
+		return nil, err
+	}
+
+	return sheet, nil
+}
+
+// estimateMonthlyCost returns the estimated monthly storage cost for a
+// container given its per-tier byte totals and a price sheet. Tiers
+// missing from the price sheet are skipped and add nothing to the estimate.
+func estimateMonthlyCost(tierBytes map[string]int64, sheet PriceSheet) float64 {
+	var cost float64
+	for tier, bytes := range tierBytes {
+		price, ok := sheet[tier]
+		if !ok {
+			continue
+		}
+		cost += bytesToGB(bytes) * price
+	}
+	return cost
+}
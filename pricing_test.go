@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPriceSheet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(`{"Hot": 0.02, "Cool": 0.01}`), 0o644); err != nil {
+		t.Fatalf("failed to write price sheet fixture: %v", err)
+	}
+
+	sheet, err := loadPriceSheet(path)
+	if err != nil {
+		t.Fatalf("loadPriceSheet returned error: %v", err)
+	}
+	if got, want := sheet["Hot"], 0.02; got != want {
+		t.Errorf("sheet[Hot] = %v, want %v", got, want)
+	}
+	if got, want := sheet["Cool"], 0.01; got != want {
+		t.Errorf("sheet[Cool] = %v, want %v", got, want)
+	}
+}
+
+func TestLoadPriceSheetMissingFile(t *testing.T) {
+	if _, err := loadPriceSheet(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error for a missing price sheet file, got nil")
+	}
+}
+
+func TestEstimateMonthlyCost(t *testing.T) {
+	sheet := PriceSheet{"Hot": 0.02, "Cool": 0.01}
+	tierBytes := map[string]int64{
+		"Hot":     2 << 30, // 2 GiB
+		"Cool":    4 << 30, // 4 GiB
+		"Archive": 8 << 30, // not in the price sheet, should be skipped
+	}
+
+	got := estimateMonthlyCost(tierBytes, sheet)
+	want := bytesToGB(2<<30)*0.02 + bytesToGB(4<<30)*0.01
+	if got != want {
+		t.Errorf("estimateMonthlyCost = %v, want %v", got, want)
+	}
+}
+
+func TestEstimateMonthlyCostEmpty(t *testing.T) {
+	if got := estimateMonthlyCost(nil, PriceSheet{"Hot": 0.02}); got != 0 {
+		t.Errorf("estimateMonthlyCost with no tiers = %v, want 0", got)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+)
+
+// listAllSubscriptionIDs returns every subscription ID the credential can
+// see, for use with -all-subscriptions.
+func listAllSubscriptionIDs(credential azcore.TokenCredential) ([]string, error) {
+	client, err := armsubscriptions.NewClient(credential, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %v", err)
+	}
+
+	var ids []string
+	pager := client.NewListPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next page: %v", err)
+		}
+		for _, sub := range page.Value {
+			ids = append(ids, *sub.SubscriptionID)
+		}
+	}
+
+	return ids, nil
+}
+
+// discoverStorageAccounts lists every storage account name in a
+// subscription, for use with -discover-accounts instead of requiring an
+// explicit -accounts list.
+func discoverStorageAccounts(ctx context.Context, credential azcore.TokenCredential, subscriptionID string) ([]string, error) {
+	client, err := armstorage.NewAccountsClient(subscriptionID, credential, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage accounts client: %v", err)
+	}
+
+	var accounts []string
+	pager := client.NewListPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list storage accounts: %v", err)
+		}
+		for _, account := range page.Value {
+			if account.Name != nil {
+				accounts = append(accounts, *account.Name)
+			}
+		}
+	}
+
+	return accounts, nil
+}